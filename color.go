@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// RGBColor is a 24-bit colour a theme can declare for a ThemeComponentId,
+// independently of the fixed ncurses component id colour table.
+type RGBColor struct {
+	Red, Green, Blue uint8
+}
+
+// ParseHexColor parses a colour of the form "#rrggbb" into an RGBColor.
+func ParseHexColor(hex string) (color RGBColor, err error) {
+	if len(hex) != 7 || hex[0] != '#' {
+		return RGBColor{}, fmt.Errorf("Invalid hex color: %v, expected format #rrggbb", hex)
+	}
+
+	value, err := strconv.ParseUint(hex[1:], 16, 32)
+	if err != nil {
+		return RGBColor{}, fmt.Errorf("Invalid hex color: %v: %v", hex, err)
+	}
+
+	return RGBColor{
+		Red:   uint8(value >> 16),
+		Green: uint8(value >> 8),
+		Blue:  uint8(value),
+	}, nil
+}
+
+// ColorSupport describes the range of colours a terminal is able to
+// display, from least to most capable.
+type ColorSupport int
+
+// The levels of colour support grv can target when resolving an RGBColor.
+const (
+	ColorSupport16 ColorSupport = iota
+	ColorSupport256
+	ColorSupportTrueColor
+)
+
+// DetermineColorSupport inspects COLORTERM (and falls back to TERM) to
+// decide how much colour fidelity the terminal grv is running in supports.
+func DetermineColorSupport() ColorSupport {
+	switch os.Getenv("COLORTERM") {
+	case "truecolor", "24bit":
+		return ColorSupportTrueColor
+	}
+
+	if term := os.Getenv("TERM"); strings.HasSuffix(term, "256color") {
+		return ColorSupport256
+	}
+
+	return ColorSupport16
+}
+
+// terminalPalette16 is the approximate RGB value of each of the 16 standard
+// ncurses colors, indexed by gc.Color value (COLOR_BLACK..COLOR_WHITE, then
+// their bold/bright counterparts).
+var terminalPalette16 = []RGBColor{
+	{0x00, 0x00, 0x00}, // black
+	{0x80, 0x00, 0x00}, // red
+	{0x00, 0x80, 0x00}, // green
+	{0x80, 0x80, 0x00}, // yellow
+	{0x00, 0x00, 0x80}, // blue
+	{0x80, 0x00, 0x80}, // magenta
+	{0x00, 0x80, 0x80}, // cyan
+	{0xc0, 0xc0, 0xc0}, // white
+	{0x80, 0x80, 0x80}, // bright black
+	{0xff, 0x00, 0x00}, // bright red
+	{0x00, 0xff, 0x00}, // bright green
+	{0xff, 0xff, 0x00}, // bright yellow
+	{0x00, 0x00, 0xff}, // bright blue
+	{0xff, 0x00, 0xff}, // bright magenta
+	{0x00, 0xff, 0xff}, // bright cyan
+	{0xff, 0xff, 0xff}, // bright white
+}
+
+// color256 approximates the standard xterm 256-color palette entry n as an
+// RGBColor: the first 16 map onto the basic palette, 16-231 are a 6x6x6
+// color cube, and 232-255 are a grayscale ramp.
+func color256(n int) RGBColor {
+	switch {
+	case n < 16:
+		return terminalPalette16[n%len(terminalPalette16)]
+	case n < 232:
+		n -= 16
+		levels := [6]uint8{0, 0x5f, 0x87, 0xaf, 0xd7, 0xff}
+		return RGBColor{Red: levels[(n/36)%6], Green: levels[(n/6)%6], Blue: levels[n%6]}
+	default:
+		gray := uint8(8 + (n-232)*10)
+		return RGBColor{Red: gray, Green: gray, Blue: gray}
+	}
+}
+
+// terminalPalette256 is the xterm 256-color palette, generated from
+// color256, used to downgrade an RGBColor for terminals that report
+// ColorSupport256.
+var terminalPalette256 = buildTerminalPalette256()
+
+func buildTerminalPalette256() []RGBColor {
+	palette := make([]RGBColor, 256)
+
+	for i := range palette {
+		palette[i] = color256(i)
+	}
+
+	return palette
+}
+
+// NearestPaletteIndex returns the index into the given palette whose colour
+// is closest to color, using a simple weighted RGB distance. This mirrors
+// the approach tools such as tcell and the colorful package use to downgrade
+// a true colour to the nearest slot a less capable terminal supports.
+func NearestPaletteIndex(color RGBColor, palette []RGBColor) int {
+	best := 0
+	bestDistance := colorDistance(color, palette[0])
+
+	for i := 1; i < len(palette); i++ {
+		if distance := colorDistance(color, palette[i]); distance < bestDistance {
+			best = i
+			bestDistance = distance
+		}
+	}
+
+	return best
+}
+
+// colorDistance computes a perceptually weighted squared RGB distance, using
+// the redmean approximation rather than plain Euclidean distance, since the
+// human eye is more sensitive to green than red or blue.
+func colorDistance(a, b RGBColor) int64 {
+	rMean := (int64(a.Red) + int64(b.Red)) / 2
+	dR := int64(a.Red) - int64(b.Red)
+	dG := int64(a.Green) - int64(b.Green)
+	dB := int64(a.Blue) - int64(b.Blue)
+
+	return (((512 + rMean) * dR * dR) >> 8) + 4*dG*dG + (((767 - rMean) * dB * dB) >> 8)
+}
+
+// ResolveColor maps an RGBColor onto the closest colour the given
+// ColorSupport level can actually display: unchanged for
+// ColorSupportTrueColor, the nearest xterm 256-color palette entry for
+// ColorSupport256, and otherwise the nearest of the 16 colors every
+// terminal grv targets is guaranteed to support.
+func ResolveColor(color RGBColor, support ColorSupport) RGBColor {
+	switch support {
+	case ColorSupportTrueColor:
+		return color
+	case ColorSupport256:
+		return terminalPalette256[NearestPaletteIndex(color, terminalPalette256)]
+	default:
+		return terminalPalette16[NearestPaletteIndex(color, terminalPalette16)]
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseHexColorParsesValidHexString(t *testing.T) {
+	color, err := ParseHexColor("#a0d0ff")
+	if err != nil {
+		t.Fatalf("Unexpected error parsing valid hex color: %v", err)
+	}
+
+	expected := RGBColor{Red: 0xa0, Green: 0xd0, Blue: 0xff}
+	if color != expected {
+		t.Errorf("Parsed color does not match expected value. Expected: %v, Actual: %v", expected, color)
+	}
+}
+
+func TestParseHexColorReturnsErrorForInvalidInput(t *testing.T) {
+	invalidInputs := []string{"", "a0d0ff", "#a0d0f", "#gggggg", "#a0d0ffff"}
+
+	for _, input := range invalidInputs {
+		if _, err := ParseHexColor(input); err == nil {
+			t.Errorf("Expected error parsing invalid hex color %q but got none", input)
+		}
+	}
+}
+
+func TestDetermineColorSupportDetectsTrueColorFromColorterm(t *testing.T) {
+	restore := setEnv(t, "COLORTERM", "truecolor")
+	defer restore()
+
+	if support := DetermineColorSupport(); support != ColorSupportTrueColor {
+		t.Errorf("Expected COLORTERM=truecolor to report ColorSupportTrueColor but got %v", support)
+	}
+}
+
+func TestDetermineColorSupportDetects256ColorFromTermSuffix(t *testing.T) {
+	restore := setEnv(t, "COLORTERM", "")
+	defer restore()
+
+	terms := []string{"xterm-256color", "screen-256color", "tmux-256color"}
+
+	for _, term := range terms {
+		restoreTerm := setEnv(t, "TERM", term)
+
+		if support := DetermineColorSupport(); support != ColorSupport256 {
+			t.Errorf("Expected TERM=%v to report ColorSupport256 but got %v", term, support)
+		}
+
+		restoreTerm()
+	}
+}
+
+func TestDetermineColorSupportFallsBackTo16Color(t *testing.T) {
+	restoreColorterm := setEnv(t, "COLORTERM", "")
+	defer restoreColorterm()
+	restoreTerm := setEnv(t, "TERM", "xterm")
+	defer restoreTerm()
+
+	if support := DetermineColorSupport(); support != ColorSupport16 {
+		t.Errorf("Expected TERM=xterm to report ColorSupport16 but got %v", support)
+	}
+}
+
+// setEnv sets key to value for the duration of a test and returns a func
+// that restores the environment variable to whatever it was beforehand.
+func setEnv(t *testing.T, key, value string) func() {
+	previous, existed := os.LookupEnv(key)
+
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatalf("Failed to set %v: %v", key, err)
+	}
+
+	return func() {
+		if existed {
+			os.Setenv(key, previous)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestNearestPaletteIndexReturnsExactMatch(t *testing.T) {
+	palette := []RGBColor{
+		{0x00, 0x00, 0x00},
+		{0xff, 0x00, 0x00},
+		{0x00, 0xff, 0x00},
+	}
+
+	index := NearestPaletteIndex(RGBColor{0x00, 0xff, 0x00}, palette)
+
+	if index != 2 {
+		t.Errorf("Expected index 2 for exact match but got %v", index)
+	}
+}
+
+func TestNearestPaletteIndexReturnsClosestColor(t *testing.T) {
+	palette := []RGBColor{
+		{0x00, 0x00, 0x00},
+		{0xff, 0xff, 0xff},
+	}
+
+	index := NearestPaletteIndex(RGBColor{0x10, 0x10, 0x10}, palette)
+
+	if index != 0 {
+		t.Errorf("Expected nearly black color to resolve to the black palette entry but got index %v", index)
+	}
+}
+
+func TestResolveColorReturnsInputUnchangedForTrueColor(t *testing.T) {
+	color := RGBColor{0x12, 0x34, 0x56}
+
+	resolved := ResolveColor(color, ColorSupportTrueColor)
+
+	if resolved != color {
+		t.Errorf("Expected true color support to leave the color unchanged. Expected: %v, Actual: %v", color, resolved)
+	}
+}
+
+func TestResolveColorDowngradesTo256ColorPalette(t *testing.T) {
+	color := RGBColor{0x12, 0x34, 0x56}
+
+	resolved := ResolveColor(color, ColorSupport256)
+
+	found := false
+	for _, paletteColor := range terminalPalette256 {
+		if paletteColor == resolved {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		t.Errorf("Expected resolved color %v to be a member of the 256-color palette", resolved)
+	}
+}
+
+func TestResolveColorDowngradesTo16ColorPalette(t *testing.T) {
+	color := RGBColor{0x12, 0x34, 0x56}
+
+	resolved := ResolveColor(color, ColorSupport16)
+
+	found := false
+	for _, paletteColor := range terminalPalette16 {
+		if paletteColor == resolved {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		t.Errorf("Expected resolved color %v to be a member of the 16-color palette", resolved)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// ImageProtocol identifies which terminal graphics protocol grv should use
+// to draw a placed image, detected once at startup from the terminal's
+// reported capabilities.
+type ImageProtocol int
+
+// The image protocols grv can target. ImageProtocolNone means the terminal
+// supports neither, and PlaceImage calls are ignored.
+const (
+	ImageProtocolNone ImageProtocol = iota
+	ImageProtocolSixel
+	ImageProtocolKitty
+)
+
+// globalImageProtocol is the image protocol detected at startup, used by
+// Window.Flush to decide how (or whether) to emit pending image placements.
+var globalImageProtocol = ImageProtocolNone
+
+// DetermineImageProtocol inspects TERM and TERM_PROGRAM to decide which (if
+// any) inline image protocol the current terminal supports. Terminals that
+// support the Kitty graphics protocol are preferred over Sixel where both
+// are advertised, since Kitty's protocol does not require a color
+// palette reduction pass.
+func DetermineImageProtocol(termProgram, term string) ImageProtocol {
+	switch termProgram {
+	case "kitty", "WezTerm":
+		return ImageProtocolKitty
+	}
+
+	switch term {
+	case "xterm-kitty":
+		return ImageProtocolKitty
+	case "mlterm", "yaft-256color", "xterm-sixel":
+		return ImageProtocolSixel
+	}
+
+	return ImageProtocolNone
+}
+
+// InitImageProtocol detects and records the inline image protocol the
+// current terminal supports, for later use by Window.Flush. It should be
+// called once during startup, after the terminal environment variables are
+// available.
+func InitImageProtocol() {
+	globalImageProtocol = DetermineImageProtocol(os.Getenv("TERM_PROGRAM"), os.Getenv("TERM"))
+}
+
+// ImagePlacement is a rasterized image reserved against a rectangle of a
+// Window's cell grid. LineBuilder writes into the covered cells are
+// suppressed so the image is not overwritten by text, and the escape
+// sequence that actually draws it is emitted on the next Flush.
+type ImagePlacement struct {
+	rowIndex uint
+	colIndex uint
+	rows     uint
+	cols     uint
+	img      image.Image
+}
+
+// PlaceImage reserves the rectangle of cells starting at rowIndex/colIndex
+// spanning rows/cols for img, suppressing LineBuilder writes into that
+// region until the next Clear. A later PlaceImage call covering the same
+// cells adds a second placement rather than replacing this one.
+func (win *Window) PlaceImage(rowIndex, colIndex, rows, cols uint, img image.Image) error {
+	if rowIndex+rows > win.rows || colIndex+cols > win.cols {
+		return fmt.Errorf("Image placement %v,%v %vx%v does not fit in window %v with dimensions %vx%v",
+			rowIndex, colIndex, rows, cols, win.id, win.rows, win.cols)
+	}
+
+	if globalImageProtocol == ImageProtocolNone {
+		return nil
+	}
+
+	win.images = append(win.images, ImagePlacement{
+		rowIndex: rowIndex,
+		colIndex: colIndex,
+		rows:     rows,
+		cols:     cols,
+		img:      img,
+	})
+
+	for r := rowIndex; r < rowIndex+rows; r++ {
+		line := win.lines[r]
+		for c := colIndex; c < colIndex+cols; c++ {
+			line.cells[c].imagePlaced = true
+		}
+	}
+
+	return nil
+}
+
+// flushImages emits the escape sequence for each pending image placement
+// through backend and clears the list, so each image is drawn once. A later
+// Flush does not draw it again, including after Invalidate or Resize, unless
+// PlaceImage is called for it again.
+func (win *Window) flushImages(backend RenderBackend) error {
+	for _, placement := range win.images {
+		var sequence string
+
+		switch globalImageProtocol {
+		case ImageProtocolSixel:
+			sequence = encodeSixel(placement.img)
+		case ImageProtocolKitty:
+			sequence = encodeKittyGraphics(placement.img)
+		default:
+			continue
+		}
+
+		if sequence == "" {
+			continue
+		}
+
+		log.Debugf("Placing image at row:%v,col:%v size:%vx%v in window %v",
+			placement.rowIndex, placement.colIndex, placement.rows, placement.cols, win.id)
+
+		if err := backend.DrawImage(win.startRow+placement.rowIndex, win.startCol+placement.colIndex, sequence); err != nil {
+			return err
+		}
+	}
+
+	win.images = win.images[:0]
+
+	return nil
+}
+
+// encodeKittyGraphics produces the APC escape sequence the Kitty graphics
+// protocol uses to display a raw RGBA image, base64-encoded inline.
+func encodeKittyGraphics(img image.Image) string {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	var pixels bytes.Buffer
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			pixels.WriteByte(byte(r >> 8))
+			pixels.WriteByte(byte(g >> 8))
+			pixels.WriteByte(byte(b >> 8))
+			pixels.WriteByte(byte(a >> 8))
+		}
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(pixels.Bytes())
+
+	return fmt.Sprintf("\x1b_Ga=T,f=32,s=%d,v=%d;%s\x1b\\", width, height, encoded)
+}
+
+// encodeSixel produces a (simplified) Sixel escape sequence for img. Colors
+// are quantised to a 16 entry palette, which keeps the encoder simple at
+// the cost of image fidelity; this is acceptable for the avatar and
+// thumbnail sized images grv places.
+func encodeSixel(img image.Image) string {
+	bounds := img.Bounds()
+	palette := terminalPalette16
+
+	var sequence bytes.Buffer
+	sequence.WriteString("\x1bPq")
+
+	for i, color := range palette {
+		sequence.WriteString(fmt.Sprintf("#%d;2;%d;%d;%d", i,
+			int(color.Red)*100/255, int(color.Green)*100/255, int(color.Blue)*100/255))
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += 6 {
+		// Every sixel advances one column whatever its colour, so each colour
+		// in this band gets its own full-width pass, ended by "$".
+		var bands [16][]byte
+
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			var rowBits [16]byte
+
+			for bit := 0; bit < 6 && y+bit < bounds.Max.Y; bit++ {
+				r, g, b, _ := img.At(x, y+bit).RGBA()
+				rgb := RGBColor{Red: uint8(r >> 8), Green: uint8(g >> 8), Blue: uint8(b >> 8)}
+				index := NearestPaletteIndex(rgb, palette)
+				rowBits[index] |= 1 << uint(bit)
+			}
+
+			for index, bits := range rowBits {
+				if bits == 0 {
+					continue
+				}
+				if bands[index] == nil {
+					bands[index] = bytes.Repeat([]byte{'?'}, bounds.Dx())
+				}
+				bands[index][x-bounds.Min.X] = '?' + bits
+			}
+		}
+
+		for index, band := range bands {
+			if band != nil {
+				sequence.WriteString(fmt.Sprintf("#%d%s$", index, band))
+			}
+		}
+
+		sequence.WriteString("-")
+	}
+
+	sequence.WriteString("\x1b\\")
+
+	return sequence.String()
+}
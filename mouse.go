@@ -0,0 +1,82 @@
+package main
+
+// HitTag is an opaque identifier a view can attach to the cells it renders
+// (a commit hash, ref name, file path, ...), so that a later click on those
+// cells can be translated back to the object the view drew there.
+type HitTag string
+
+// MouseButton identifies which button (or wheel direction) a MouseEvent was
+// generated by.
+type MouseButton int
+
+// The set of mouse buttons and wheel directions grv recognises.
+const (
+	MouseButtonNone MouseButton = iota
+	MouseButtonLeft
+	MouseButtonMiddle
+	MouseButtonRight
+	MouseWheelUp
+	MouseWheelDown
+)
+
+// MouseEvent represents a single mouse click, drag or scroll, decoded from
+// the terminal's raw mouse reporting protocol by whichever RenderBackend is
+// active.
+type MouseEvent struct {
+	row    uint
+	col    uint
+	button MouseButton
+	drag   bool
+}
+
+// Keystring returns the keystring a MouseEvent maps to, so it can be looked
+// up through the same Binding mechanism key presses already use (e.g.
+// "<mouse-left>", "<wheel-up>").
+func (event MouseEvent) Keystring() string {
+	switch event.button {
+	case MouseButtonLeft:
+		if event.drag {
+			return "<mouse-left-drag>"
+		}
+		return "<mouse-left>"
+	case MouseButtonMiddle:
+		return "<mouse-middle>"
+	case MouseButtonRight:
+		return "<mouse-right>"
+	case MouseWheelUp:
+		return "<wheel-up>"
+	case MouseWheelDown:
+		return "<wheel-down>"
+	default:
+		return ""
+	}
+}
+
+// HitTest translates an absolute terminal row/col (as reported by a
+// MouseEvent) into the HitTag a view tagged at that position, if any. Cells
+// outside the window's bounds, or never tagged by the view that rendered
+// them, return the empty HitTag.
+func (win *Window) HitTest(row, col uint) HitTag {
+	if row < win.startRow || row >= win.startRow+win.rows ||
+		col < win.startCol || col >= win.startCol+win.cols {
+		return ""
+	}
+
+	line := win.lines[row-win.startRow]
+	cell := line.cells[col-win.startCol]
+
+	return cell.hitTag
+}
+
+// ProcessBackendEvent translates a BackendEvent into the keystring grv's
+// input pipeline already knows how to route through Binding, so key presses
+// and mouse events both feed InputBuffer.Append through the same path. Mouse
+// events additionally carry their row/col for hit-testing against the
+// focused view's Window.
+func ProcessBackendEvent(event BackendEvent) (keystring string, mouseEvent MouseEvent, isMouse bool) {
+	if event.Type != BackendEventMouse {
+		return event.Key, MouseEvent{}, false
+	}
+
+	return event.Mouse.Keystring(), event.Mouse, true
+}
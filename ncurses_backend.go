@@ -0,0 +1,260 @@
+package main
+
+import (
+	"os"
+
+	gc "github.com/rthornton128/goncurses"
+)
+
+// ncursesBackend is the original RenderBackend implementation, backed by
+// goncurses. It is the default backend and the one grv has always used.
+type ncursesBackend struct {
+	stdscr            *gc.Window
+	colorSupport      ColorSupport
+	colorPairs        map[[2]int16]int16
+	nextPair          int16
+	extendedColors    map[RGBColor]int16
+	nextExtendedColor int16
+}
+
+// newNcursesBackend creates a RenderBackend backed by goncurses.
+func newNcursesBackend() RenderBackend {
+	return &ncursesBackend{
+		colorSupport:      DetermineColorSupport(),
+		colorPairs:        make(map[[2]int16]int16),
+		nextPair:          1,
+		extendedColors:    make(map[RGBColor]int16),
+		nextExtendedColor: 16,
+	}
+}
+
+// colorPair returns the ncurses color pair that best approximates fg/bg,
+// allocating and initialising a new pair the first time a combination is
+// seen. The precision fg/bg are resolved to depends on backend.colorSupport:
+// a true color terminal gets the exact RGB value via an extended color
+// slot, a 256-color terminal gets the nearest xterm 256-color palette
+// entry, and anything less capable gets the nearest of the 16 standard
+// colors every terminal is assumed to support.
+func (backend *ncursesBackend) colorPair(fg, bg *RGBColor) int16 {
+	if fg == nil && bg == nil {
+		return 0
+	}
+
+	fgIndex, bgIndex := backend.colorIndex(fg), backend.colorIndex(bg)
+
+	key := [2]int16{fgIndex, bgIndex}
+
+	if pair, exists := backend.colorPairs[key]; exists {
+		return pair
+	}
+
+	pair := backend.nextPair
+	backend.nextPair++
+
+	if backend.colorSupport == ColorSupportTrueColor {
+		gc.InitExtendedPair(int32(pair), int32(fgIndex), int32(bgIndex))
+	} else {
+		gc.InitPair(pair, fgIndex, bgIndex)
+	}
+
+	backend.colorPairs[key] = pair
+
+	return pair
+}
+
+// colorIndex resolves a single optional colour to the ncurses color index
+// (basic, 256-color, or extended true color slot) matching
+// backend.colorSupport, returning -1 for "use the terminal default".
+func (backend *ncursesBackend) colorIndex(color *RGBColor) int16 {
+	if color == nil {
+		return -1
+	}
+
+	switch backend.colorSupport {
+	case ColorSupportTrueColor:
+		return backend.extendedColorIndex(*color)
+	case ColorSupport256:
+		return int16(NearestPaletteIndex(*color, terminalPalette256))
+	default:
+		return int16(NearestPaletteIndex(*color, terminalPalette16))
+	}
+}
+
+// extendedColorIndex allocates (and caches) an ncurses extended color slot
+// holding the exact RGB value of color, for use on true color terminals
+// where the fixed 16/256 entry palettes would lose precision.
+func (backend *ncursesBackend) extendedColorIndex(color RGBColor) int16 {
+	if index, exists := backend.extendedColors[color]; exists {
+		return index
+	}
+
+	index := backend.nextExtendedColor
+	backend.nextExtendedColor++
+
+	gc.InitExtendedColor(int32(index), scaleTo1000(color.Red), scaleTo1000(color.Green), scaleTo1000(color.Blue))
+	backend.extendedColors[color] = index
+
+	return index
+}
+
+// scaleTo1000 converts an 8-bit colour component to the 0-1000 range
+// ncurses' init_extended_color expects.
+func scaleTo1000(component uint8) int32 {
+	return int32(component) * 1000 / 255
+}
+
+func (backend *ncursesBackend) Init() (err error) {
+	stdscr, err := gc.Init()
+	if err != nil {
+		return
+	}
+
+	gc.Echo(false)
+	gc.CBreak(true)
+	gc.Cursor(0)
+	stdscr.Keypad(true)
+	gc.StartColor()
+
+	// Report button presses/releases, wheel events and drags. SGR 1006
+	// extended coordinates are not requested here, so clicks past column
+	// 223 decode correctly only where ncurses already uses that encoding
+	// for the terminal.
+	gc.MouseMask(gc.M_ALL|gc.M_POSITION, nil)
+
+	backend.stdscr = stdscr
+
+	return
+}
+
+func (backend *ncursesBackend) Shutdown() {
+	gc.End()
+}
+
+func (backend *ncursesBackend) Size() (rows, cols uint, err error) {
+	y, x := backend.stdscr.MaxYX()
+	return uint(y), uint(x), nil
+}
+
+// gcAttr maps grv's backend-neutral Attr bitmask onto the gc.Char attribute
+// bits goncurses expects.
+func gcAttr(attr Attr) gc.Char {
+	var ch gc.Char
+
+	if attr&AttrBold != 0 {
+		ch |= gc.A_BOLD
+	}
+
+	if attr&AttrDim != 0 {
+		ch |= gc.A_DIM
+	}
+
+	if attr&AttrReverse != 0 {
+		ch |= gc.A_REVERSE
+	}
+
+	if attr&AttrUnderline != 0 {
+		ch |= gc.A_UNDERLINE
+	}
+
+	return ch
+}
+
+func (backend *ncursesBackend) SetCell(row, col uint, codePoint rune, style CellStyle) error {
+	ch := gc.Char(codePoint) | gcAttr(style.attr)
+
+	if style.acs_char != 0 {
+		ch = style.acs_char | gcAttr(style.attr)
+	}
+
+	if pair := backend.colorPair(style.fg, style.bg); pair != 0 {
+		ch |= gc.ColorPair(pair)
+	}
+
+	backend.stdscr.MoveAddChar(int(row), int(col), ch)
+
+	return nil
+}
+
+func (backend *ncursesBackend) SetCursor(row, col uint) error {
+	backend.stdscr.Move(int(row), int(col))
+	return nil
+}
+
+func (backend *ncursesBackend) HideCursor() {
+	gc.Cursor(0)
+}
+
+func (backend *ncursesBackend) Flush() error {
+	return backend.stdscr.Refresh()
+}
+
+// DrawImage moves the ncurses cursor to row/col and refreshes so goncurses'
+// own idea of the cursor position is in sync, then writes sequence straight
+// to the terminal. goncurses has no API of its own for emitting an arbitrary
+// escape sequence, so this is the narrowest point that needs to reach past
+// it; every other cell write still goes through SetCell.
+func (backend *ncursesBackend) DrawImage(row, col uint, sequence string) error {
+	backend.stdscr.Move(int(row), int(col))
+
+	if err := backend.stdscr.Refresh(); err != nil {
+		return err
+	}
+
+	_, err := os.Stdout.WriteString(sequence)
+	return err
+}
+
+func (backend *ncursesBackend) PollEvent() (BackendEvent, error) {
+	key := backend.stdscr.GetChar()
+
+	switch key {
+	case gc.Key(gc.KEY_RESIZE):
+		rows, cols, err := backend.Size()
+		if err != nil {
+			return BackendEvent{}, err
+		}
+
+		return BackendEvent{Type: BackendEventResize, Rows: rows, Cols: cols}, nil
+	case gc.Key(gc.KEY_MOUSE):
+		mouseEvent, err := decodeNcursesMouseEvent()
+		if err != nil {
+			return BackendEvent{}, err
+		}
+
+		return BackendEvent{Type: BackendEventMouse, Mouse: mouseEvent}, nil
+	}
+
+	return BackendEvent{Type: BackendEventKey, Key: string(rune(key))}, nil
+}
+
+// decodeNcursesMouseEvent reads the mouse event ncurses has queued after
+// reporting a gc.KEY_MOUSE key press and converts it into grv's
+// backend-neutral MouseEvent.
+func decodeNcursesMouseEvent() (event MouseEvent, err error) {
+	mouseEvent, err := gc.GetMouse()
+	if err != nil {
+		return
+	}
+
+	event = MouseEvent{
+		row: uint(mouseEvent.Y),
+		col: uint(mouseEvent.X),
+	}
+
+	switch {
+	case mouseEvent.State&gc.M_B1_PRESSED != 0:
+		event.button = MouseButtonLeft
+	case mouseEvent.State&gc.M_B2_PRESSED != 0:
+		event.button = MouseButtonMiddle
+	case mouseEvent.State&gc.M_B3_PRESSED != 0:
+		event.button = MouseButtonRight
+	case mouseEvent.State&gc.M_B4_PRESSED != 0:
+		event.button = MouseWheelUp
+	case mouseEvent.State&gc.M_B5_PRESSED != 0:
+		event.button = MouseWheelDown
+	}
+
+	event.drag = mouseEvent.State&gc.M_DRAG != 0
+
+	return
+}
@@ -0,0 +1,65 @@
+package main
+
+// RenderBackend abstracts the terminal library used to draw a Window's cells
+// to the physical screen. Window and LineBuilder only ever build up an
+// in-memory grid of Cells; a RenderBackend is responsible for turning that
+// grid into whatever a real terminal understands. This allows goncurses to
+// be swapped out for another implementation (e.g. tcell) without changing
+// any of the code that populates Lines and Cells.
+type RenderBackend interface {
+	// Init prepares the backend for use and must be called before any other
+	// method.
+	Init() error
+	// Shutdown releases any resources acquired by Init and restores the
+	// terminal to its original state.
+	Shutdown()
+	// Size returns the current dimensions of the terminal.
+	Size() (rows, cols uint, err error)
+	// SetCell writes a single styled code point at the given row and column.
+	SetCell(row, col uint, codePoint rune, style CellStyle) error
+	// SetCursor moves the terminal cursor to the given row and column.
+	SetCursor(row, col uint) error
+	// HideCursor hides the terminal cursor.
+	HideCursor()
+	// Flush pushes any buffered cell writes to the terminal.
+	Flush() error
+	// DrawImage emits a raw terminal escape sequence (a Sixel or Kitty
+	// graphics payload) positioned at the given row and column. It exists
+	// so inline image placements reach the terminal through the same
+	// backend each implementation otherwise guards exclusively, instead of
+	// racing the backend's own screen model with a direct stdout write.
+	DrawImage(row, col uint, sequence string) error
+	// PollEvent blocks until an input or resize event is available.
+	PollEvent() (BackendEvent, error)
+}
+
+// BackendEventType describes the category of event a RenderBackend can emit.
+type BackendEventType int
+
+// The set of event types a RenderBackend can produce.
+const (
+	BackendEventNone BackendEventType = iota
+	BackendEventKey
+	BackendEventResize
+	BackendEventMouse
+)
+
+// BackendEvent is a single input or signal event read from a RenderBackend.
+type BackendEvent struct {
+	Type  BackendEventType
+	Key   string
+	Rows  uint
+	Cols  uint
+	Mouse MouseEvent
+}
+
+// NewRenderBackend constructs the RenderBackend selected by the
+// tui-backend config variable, defaulting to the goncurses backend grv has
+// always used.
+func NewRenderBackend(config Config) RenderBackend {
+	if config.GetString(CV_TUI_BACKEND) == "tcell" {
+		return newTcellBackend()
+	}
+
+	return newNcursesBackend()
+}
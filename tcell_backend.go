@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gdamore/tcell"
+)
+
+// tcellBackend is a RenderBackend implementation backed by
+// github.com/gdamore/tcell, offered as an alternative to the default
+// goncurses backend. Unlike goncurses it has no cgo dependency on a system
+// ncurses library, so it also works on platforms (e.g. Windows) where
+// goncurses is unavailable.
+type tcellBackend struct {
+	screen tcell.Screen
+}
+
+// newTcellBackend creates a RenderBackend backed by tcell.
+func newTcellBackend() RenderBackend {
+	return &tcellBackend{}
+}
+
+func (backend *tcellBackend) Init() (err error) {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return
+	}
+
+	if err = screen.Init(); err != nil {
+		return
+	}
+
+	screen.HideCursor()
+	screen.EnableMouse()
+	backend.screen = screen
+
+	return
+}
+
+func (backend *tcellBackend) Shutdown() {
+	backend.screen.Fini()
+}
+
+func (backend *tcellBackend) Size() (rows, cols uint, err error) {
+	cols32, rows32 := backend.screen.Size()
+	return uint(rows32), uint(cols32), nil
+}
+
+func (backend *tcellBackend) SetCell(row, col uint, codePoint rune, style CellStyle) error {
+	if style.acs_char != 0 {
+		if borderRune, ok := acsToUnicodeBorder[style.acs_char]; ok {
+			codePoint = borderRune
+		}
+	}
+
+	backend.screen.SetContent(int(col), int(row), codePoint, nil, tcellStyle(style))
+	return nil
+}
+
+func (backend *tcellBackend) SetCursor(row, col uint) error {
+	backend.screen.ShowCursor(int(col), int(row))
+	return nil
+}
+
+func (backend *tcellBackend) HideCursor() {
+	backend.screen.HideCursor()
+}
+
+func (backend *tcellBackend) Flush() error {
+	backend.screen.Show()
+	return nil
+}
+
+// DrawImage flushes tcell's own buffered cell writes first, so the escape
+// sequence it then writes straight to the terminal isn't immediately
+// clobbered by a later Show(), and is itself not stomped by one still in
+// flight. A CUP sequence placing the cursor at row/col precedes it.
+func (backend *tcellBackend) DrawImage(row, col uint, sequence string) error {
+	backend.screen.Show()
+
+	_, err := os.Stdout.WriteString(fmt.Sprintf("\x1b[%d;%dH%s", row+1, col+1, sequence))
+	return err
+}
+
+func (backend *tcellBackend) PollEvent() (BackendEvent, error) {
+	switch event := backend.screen.PollEvent().(type) {
+	case *tcell.EventResize:
+		cols, rows := event.Size()
+		return BackendEvent{Type: BackendEventResize, Rows: uint(rows), Cols: uint(cols)}, nil
+	case *tcell.EventKey:
+		return BackendEvent{Type: BackendEventKey, Key: tcellKeyString(event)}, nil
+	case *tcell.EventMouse:
+		return BackendEvent{Type: BackendEventMouse, Mouse: decodeTcellMouseEvent(event)}, nil
+	}
+
+	return BackendEvent{Type: BackendEventNone}, nil
+}
+
+// decodeTcellMouseEvent converts a tcell mouse event into grv's
+// backend-neutral MouseEvent.
+func decodeTcellMouseEvent(event *tcell.EventMouse) MouseEvent {
+	col, row := event.Position()
+	mouseEvent := MouseEvent{row: uint(row), col: uint(col)}
+
+	switch {
+	case event.Buttons()&tcell.Button1 != 0:
+		mouseEvent.button = MouseButtonLeft
+	case event.Buttons()&tcell.Button2 != 0:
+		mouseEvent.button = MouseButtonMiddle
+	case event.Buttons()&tcell.Button3 != 0:
+		mouseEvent.button = MouseButtonRight
+	case event.Buttons()&tcell.WheelUp != 0:
+		mouseEvent.button = MouseWheelUp
+	case event.Buttons()&tcell.WheelDown != 0:
+		mouseEvent.button = MouseWheelDown
+	}
+
+	return mouseEvent
+}
+
+// tcellStyle maps a CellStyle onto the closest tcell.Style, translating its
+// explicit RGB colours and the attribute bits known to grv. The acs border
+// char is handled by SetCell, not here.
+func tcellStyle(style CellStyle) tcell.Style {
+	tstyle := tcell.StyleDefault
+
+	if style.fg != nil {
+		tstyle = tstyle.Foreground(tcell.NewRGBColor(int32(style.fg.Red), int32(style.fg.Green), int32(style.fg.Blue)))
+	}
+
+	if style.bg != nil {
+		tstyle = tstyle.Background(tcell.NewRGBColor(int32(style.bg.Red), int32(style.bg.Green), int32(style.bg.Blue)))
+	}
+
+	if style.attr&AttrReverse != 0 {
+		tstyle = tstyle.Reverse(true)
+	}
+
+	if style.attr&AttrBold != 0 {
+		tstyle = tstyle.Bold(true)
+	}
+
+	if style.attr&AttrDim != 0 {
+		tstyle = tstyle.Dim(true)
+	}
+
+	if style.attr&AttrUnderline != 0 {
+		tstyle = tstyle.Underline(true)
+	}
+
+	return tstyle
+}
+
+// tcellKeyString converts a tcell key event into the keystring format grv's
+// key bindings are expressed in.
+func tcellKeyString(event *tcell.EventKey) string {
+	if event.Key() == tcell.KeyRune {
+		return string(event.Rune())
+	}
+
+	return event.Name()
+}
@@ -0,0 +1,550 @@
+package main
+
+import (
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/creack/pty"
+)
+
+// terminalParserState tracks where TerminalBuffer currently is within an
+// escape sequence while consuming a child process' output byte by byte.
+type terminalParserState int
+
+// The states the VT100/ANSI parser moves through as it consumes bytes.
+const (
+	tpsGround terminalParserState = iota
+	tpsEscape
+	tpsCSI
+	tpsOSC
+)
+
+// TerminalBuffer is a minimal in-process VT100/ANSI terminal emulator. It
+// consumes the raw byte stream produced by a child process (run behind a
+// pty by the caller) and maintains a grid of Cells compatible with the
+// Line/CellStyle model Window already uses, so the result can be blitted
+// into any RenderWindow region without grv needing to shell out to a full
+// screen program to show colored command output.
+type TerminalBuffer struct {
+	rows, cols uint
+	lines      []*Line
+	config     Config
+	pty        *os.File
+
+	cursorRow, cursorCol uint
+	savedCursorRow       uint
+	savedCursorCol       uint
+
+	style CellStyle
+
+	autowrap      bool
+	pendingWrap   bool
+	scrollTop     uint
+	scrollBottom  uint
+
+	state    terminalParserState
+	csiParam []byte
+}
+
+// NewTerminalBuffer creates a TerminalBuffer of the given dimensions.
+func NewTerminalBuffer(rows, cols uint, config Config) *TerminalBuffer {
+	buffer := &TerminalBuffer{
+		config:       config,
+		autowrap:     true,
+		scrollBottom: rows - 1,
+	}
+
+	buffer.Resize(rows, cols)
+
+	return buffer
+}
+
+// SetPty attaches the pty the buffer's child process is running behind, so
+// Resize can propagate the hosting Window's new dimensions to the child as
+// a SIGWINCH and Input can forward keystrokes to it. A TerminalBuffer used
+// to parse a one-shot, non-interactive capture (e.g. `git diff --color`)
+// can leave this unset.
+func (buffer *TerminalBuffer) SetPty(childPty *os.File) {
+	buffer.pty = childPty
+}
+
+// Resize changes the dimensions of the buffer, preserving existing content
+// where possible. It should be called whenever the hosting Window is
+// resized, and propagates the new size to the child process behind
+// buffer.pty (if any) as a SIGWINCH, so e.g. a shell pane reflows its own
+// output to match.
+func (buffer *TerminalBuffer) Resize(rows, cols uint) {
+	lines := make([]*Line, rows)
+
+	for i := uint(0); i < rows; i++ {
+		if buffer.lines != nil && i < uint(len(buffer.lines)) {
+			lines[i] = buffer.lines[i]
+		} else {
+			lines[i] = NewLine(cols)
+		}
+	}
+
+	buffer.lines = lines
+	buffer.rows = rows
+	buffer.cols = cols
+	buffer.scrollTop = 0
+	buffer.scrollBottom = rows - 1
+
+	if buffer.cursorRow >= rows {
+		buffer.cursorRow = rows - 1
+	}
+
+	if buffer.cursorCol >= cols {
+		buffer.cursorCol = cols - 1
+	}
+
+	if buffer.pty != nil {
+		if err := pty.Setsize(buffer.pty, &pty.Winsize{Rows: uint16(rows), Cols: uint16(cols)}); err != nil {
+			log.Errorf("Failed to resize pty to rows:%v,cols:%v: %v", rows, cols, err)
+		}
+	}
+}
+
+// Lines returns the current grid of Cells the buffer holds, suitable for
+// copying into a RenderWindow region.
+func (buffer *TerminalBuffer) Lines() []*Line {
+	return buffer.lines
+}
+
+// Write feeds a chunk of the child process' output into the parser. Unknown
+// or malformed escape sequences are dropped without disturbing the parser
+// state machine, so a single corrupt sequence cannot desync the rest of the
+// stream.
+func (buffer *TerminalBuffer) Write(data []byte) (n int, err error) {
+	for _, b := range data {
+		buffer.processByte(b)
+	}
+
+	return len(data), nil
+}
+
+// Input forwards a keystroke grv's input buffer captured to the child
+// process behind buffer.pty, so an interactive pane (a shell, `less`, a
+// pager) sees it exactly as if it had been typed at its own terminal. It is
+// a no-op if no pty has been attached via SetPty.
+func (buffer *TerminalBuffer) Input(data []byte) (n int, err error) {
+	if buffer.pty == nil {
+		return len(data), nil
+	}
+
+	return buffer.pty.Write(data)
+}
+
+func (buffer *TerminalBuffer) processByte(b byte) {
+	switch buffer.state {
+	case tpsGround:
+		buffer.processGroundByte(b)
+	case tpsEscape:
+		buffer.processEscapeByte(b)
+	case tpsCSI:
+		buffer.processCSIByte(b)
+	case tpsOSC:
+		buffer.processOSCByte(b)
+	}
+}
+
+func (buffer *TerminalBuffer) processGroundByte(b byte) {
+	switch b {
+	case 0x1B:
+		buffer.state = tpsEscape
+	case '\b':
+		buffer.moveCursor(0, -1)
+	case '\t':
+		tabWidth := uint(buffer.config.GetInt(CV_TAB_WIDTH))
+		buffer.cursorCol = ((buffer.cursorCol / tabWidth) + 1) * tabWidth
+		buffer.clampCursor()
+	case '\n', '\v', '\f':
+		buffer.lineFeed()
+	case '\r':
+		buffer.cursorCol = 0
+		buffer.pendingWrap = false
+	default:
+		buffer.writeRune(rune(b))
+	}
+}
+
+func (buffer *TerminalBuffer) processEscapeByte(b byte) {
+	switch b {
+	case '[':
+		buffer.state = tpsCSI
+		buffer.csiParam = buffer.csiParam[:0]
+	case ']':
+		buffer.state = tpsOSC
+	case '7':
+		buffer.savedCursorRow, buffer.savedCursorCol = buffer.cursorRow, buffer.cursorCol
+		buffer.state = tpsGround
+	case '8':
+		buffer.cursorRow, buffer.cursorCol = buffer.savedCursorRow, buffer.savedCursorCol
+		buffer.state = tpsGround
+	default:
+		// Unrecognised escape sequence; drop it and resynchronise on the
+		// next byte rather than risk desyncing the parser.
+		buffer.state = tpsGround
+	}
+}
+
+func (buffer *TerminalBuffer) processOSCByte(b byte) {
+	switch b {
+	case 0x07:
+		buffer.state = tpsGround
+	case 0x1B:
+		// Start of the ESC \ string terminator; the escape state drops the
+		// backslash that follows.
+		buffer.state = tpsEscape
+	}
+}
+
+func (buffer *TerminalBuffer) processCSIByte(b byte) {
+	// Parameter (0x30-0x3F) and intermediate (0x20-0x2F) bytes are collected
+	// until the final byte; sequences using any beyond digits, ';' and '?'
+	// are consumed whole and dropped.
+	if b >= 0x20 && b <= 0x3F {
+		buffer.csiParam = append(buffer.csiParam, b)
+		return
+	}
+
+	supported := true
+	for _, p := range buffer.csiParam {
+		if (p < '0' || p > '9') && p != ';' && p != '?' {
+			supported = false
+		}
+	}
+
+	if supported {
+		buffer.executeCSI(b, parseCSIParams(buffer.csiParam))
+	}
+
+	buffer.state = tpsGround
+}
+
+func parseCSIParams(raw []byte) []int {
+	var params []int
+	value := -1
+
+	for _, b := range raw {
+		if b == ';' {
+			params = append(params, value)
+			value = -1
+			continue
+		}
+
+		if b < '0' || b > '9' {
+			continue
+		}
+
+		if value == -1 {
+			value = 0
+		}
+
+		value = value*10 + int(b-'0')
+	}
+
+	params = append(params, value)
+
+	return params
+}
+
+func csiParam(params []int, index, fallback int) int {
+	if index >= len(params) || params[index] < 0 {
+		return fallback
+	}
+
+	return params[index]
+}
+
+func (buffer *TerminalBuffer) executeCSI(final byte, params []int) {
+	switch final {
+	case 'A':
+		buffer.moveCursor(-csiParam(params, 0, 1), 0)
+	case 'B':
+		buffer.moveCursor(csiParam(params, 0, 1), 0)
+	case 'C':
+		buffer.moveCursor(0, csiParam(params, 0, 1))
+	case 'D':
+		buffer.moveCursor(0, -csiParam(params, 0, 1))
+	case 'H', 'f':
+		buffer.cursorRow = clampUint(uint(csiParam(params, 0, 1))-1, buffer.rows)
+		buffer.cursorCol = clampUint(uint(csiParam(params, 1, 1))-1, buffer.cols)
+		buffer.pendingWrap = false
+	case 'J':
+		buffer.eraseDisplay(csiParam(params, 0, 0))
+	case 'K':
+		buffer.eraseLine(csiParam(params, 0, 0))
+	case 'r':
+		buffer.scrollTop = clampUint(uint(csiParam(params, 0, 1))-1, buffer.rows)
+		buffer.scrollBottom = clampUint(uint(csiParam(params, 1, int(buffer.rows)))-1, buffer.rows)
+	case 'm':
+		buffer.selectGraphicRendition(params)
+	case 'h', 'l':
+		buffer.setMode(params, final == 'h')
+	}
+}
+
+func (buffer *TerminalBuffer) setMode(params []int, enabled bool) {
+	// DECAWM (autowrap) is the only private mode grv currently needs to
+	// track; all others are accepted and ignored.
+	if len(params) > 0 && params[0] == 7 {
+		buffer.autowrap = enabled
+	}
+}
+
+func clampUint(value, limit uint) uint {
+	if limit == 0 {
+		return 0
+	}
+
+	if value >= limit {
+		return limit - 1
+	}
+
+	return value
+}
+
+func (buffer *TerminalBuffer) moveCursor(rowDelta, colDelta int) {
+	buffer.cursorRow = offsetCursor(buffer.cursorRow, rowDelta, buffer.rows)
+	buffer.cursorCol = offsetCursor(buffer.cursorCol, colDelta, buffer.cols)
+	buffer.pendingWrap = false
+}
+
+// offsetCursor applies delta to value and clamps the result to [0,limit),
+// rather than relying on Window's applyOffset, which underflows a uint at
+// zero for a negative delta (e.g. cursor-up at row 0) and would otherwise
+// wrap the cursor around to the opposite edge of the buffer instead of
+// leaving it pinned at the boundary.
+func offsetCursor(value uint, delta int, limit uint) uint {
+	if limit == 0 {
+		return 0
+	}
+
+	result := int(value) + delta
+
+	if result < 0 {
+		return 0
+	}
+
+	if result >= int(limit) {
+		return limit - 1
+	}
+
+	return uint(result)
+}
+
+func (buffer *TerminalBuffer) clampCursor() {
+	if buffer.cursorRow >= buffer.rows {
+		buffer.cursorRow = buffer.rows - 1
+	}
+
+	if buffer.cursorCol >= buffer.cols {
+		buffer.cursorCol = buffer.cols - 1
+	}
+}
+
+func (buffer *TerminalBuffer) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		buffer.eraseLine(0)
+		for row := buffer.cursorRow + 1; row < buffer.rows; row++ {
+			buffer.clearLine(row)
+		}
+	case 1:
+		for row := uint(0); row < buffer.cursorRow; row++ {
+			buffer.clearLine(row)
+		}
+		buffer.eraseLine(1)
+	case 2, 3:
+		for row := uint(0); row < buffer.rows; row++ {
+			buffer.clearLine(row)
+		}
+	}
+}
+
+func (buffer *TerminalBuffer) eraseLine(mode int) {
+	line := buffer.lines[buffer.cursorRow]
+
+	switch mode {
+	case 0:
+		for col := buffer.cursorCol; col < uint(len(line.cells)); col++ {
+			buffer.clearCell(line, col)
+		}
+	case 1:
+		for col := uint(0); col <= buffer.cursorCol && col < uint(len(line.cells)); col++ {
+			buffer.clearCell(line, col)
+		}
+	case 2:
+		buffer.clearLine(buffer.cursorRow)
+	}
+}
+
+func (buffer *TerminalBuffer) clearLine(row uint) {
+	line := buffer.lines[row]
+
+	for col := range line.cells {
+		buffer.clearCell(line, uint(col))
+	}
+}
+
+func (buffer *TerminalBuffer) clearCell(line *Line, col uint) {
+	cell := line.cells[col]
+	cell.codePoints.Reset()
+	cell.codePoints.WriteRune(' ')
+	cell.style = CellStyle{}
+}
+
+func (buffer *TerminalBuffer) lineFeed() {
+	if buffer.cursorRow == buffer.scrollBottom {
+		buffer.scrollUp()
+	} else {
+		buffer.cursorRow++
+		buffer.clampCursor()
+	}
+
+	buffer.pendingWrap = false
+}
+
+func (buffer *TerminalBuffer) scrollUp() {
+	top, bottom := buffer.scrollTop, buffer.scrollBottom
+
+	if bottom >= uint(len(buffer.lines)) {
+		bottom = uint(len(buffer.lines)) - 1
+	}
+
+	copy(buffer.lines[top:bottom], buffer.lines[top+1:bottom+1])
+	buffer.lines[bottom] = NewLine(buffer.cols)
+}
+
+func (buffer *TerminalBuffer) writeRune(codePoint rune) {
+	if buffer.pendingWrap {
+		if buffer.autowrap {
+			buffer.cursorCol = 0
+			buffer.lineFeed()
+		}
+		buffer.pendingWrap = false
+	}
+
+	if buffer.cursorRow >= uint(len(buffer.lines)) {
+		return
+	}
+
+	line := buffer.lines[buffer.cursorRow]
+
+	if buffer.cursorCol >= uint(len(line.cells)) {
+		return
+	}
+
+	cell := line.cells[buffer.cursorCol]
+	cell.codePoints.Reset()
+	cell.codePoints.WriteRune(codePoint)
+	cell.style = buffer.style
+
+	if buffer.cursorCol+1 >= uint(len(line.cells)) {
+		buffer.pendingWrap = true
+	} else {
+		buffer.cursorCol++
+	}
+}
+
+func (buffer *TerminalBuffer) selectGraphicRendition(params []int) {
+	if len(params) == 0 {
+		buffer.style = CellStyle{}
+		return
+	}
+
+	for i := 0; i < len(params); i++ {
+		switch p := params[i]; {
+		case p <= 0:
+			buffer.style = CellStyle{}
+		case p == 1:
+			buffer.style.attr |= AttrBold
+		case p == 4:
+			buffer.style.attr |= AttrUnderline
+		case p == 7:
+			buffer.style.attr |= AttrReverse
+		case p == 22:
+			buffer.style.attr &^= AttrBold
+		case p == 24:
+			buffer.style.attr &^= AttrUnderline
+		case p == 27:
+			buffer.style.attr &^= AttrReverse
+		case p >= 30 && p <= 37:
+			color := terminalPalette16[p-30]
+			buffer.style.fg = &color
+		case p == 38:
+			if consumed, color := parseExtendedColor(params[i+1:]); color != nil {
+				buffer.style.fg = color
+				i += consumed
+			}
+		case p == 39:
+			buffer.style.fg = nil
+		case p >= 40 && p <= 47:
+			color := terminalPalette16[p-40]
+			buffer.style.bg = &color
+		case p == 48:
+			if consumed, color := parseExtendedColor(params[i+1:]); color != nil {
+				buffer.style.bg = color
+				i += consumed
+			}
+		case p == 49:
+			buffer.style.bg = nil
+		}
+	}
+}
+
+// parseExtendedColor parses the parameters following an SGR 38/48 code,
+// supporting both the 256-color form (5;n) and the truecolor form
+// (2;r;g;b). It returns how many extra parameters were consumed.
+func parseExtendedColor(params []int) (consumed int, color *RGBColor) {
+	if len(params) == 0 {
+		return 0, nil
+	}
+
+	switch params[0] {
+	case 5:
+		if len(params) < 2 {
+			return 1, nil
+		}
+		rgb := color256(params[1])
+		return 2, &rgb
+	case 2:
+		if len(params) < 4 {
+			return len(params), nil
+		}
+		rgb := RGBColor{Red: uint8(params[1]), Green: uint8(params[2]), Blue: uint8(params[3])}
+		return 4, &rgb
+	}
+
+	return 1, nil
+}
+
+
+// WriteTo copies the buffer's current contents into the given RenderWindow
+// region, starting at startRow/startCol. Text and colours are copied; the
+// bold, underline and reverse attribute bits the buffer tracks are not.
+func (buffer *TerminalBuffer) WriteTo(window RenderWindow, startRow, startCol uint) error {
+	for row, line := range buffer.lines {
+		lineBuilder, err := window.LineBuilder(startRow+uint(row), 1)
+		if err != nil {
+			return err
+		}
+
+		lineBuilder.cellIndex = startCol
+		lineBuilder.column = startCol + 1
+
+		for _, cell := range line.cells {
+			text := cell.codePoints.String()
+			if text == "" {
+				text = " "
+			}
+
+			lineBuilder.AppendWithStyleAndColor(cell.style.componentId, cell.style.fg, cell.style.bg, "%s", text)
+		}
+	}
+
+	log.Debugf("Wrote terminal buffer of size rows:%v,cols:%v to window %v", buffer.rows, buffer.cols, window.Id())
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/creack/pty"
+)
+
+// stubConfig is a minimal Config implementation for tests that only need a
+// fixed tab width.
+type stubConfig struct {
+	tabWidth int
+}
+
+func (config *stubConfig) GetInt(configVariable ConfigVariable) int {
+	return config.tabWidth
+}
+
+func (config *stubConfig) GetString(configVariable ConfigVariable) string {
+	return ""
+}
+
+func newTestTerminalBuffer(rows, cols uint) *TerminalBuffer {
+	return NewTerminalBuffer(rows, cols, &stubConfig{tabWidth: 8})
+}
+
+func cellText(buffer *TerminalBuffer, row, col uint) string {
+	return buffer.Lines()[row].cells[col].codePoints.String()
+}
+
+func TestTerminalBufferWritesPlainText(t *testing.T) {
+	buffer := newTestTerminalBuffer(5, 10)
+
+	buffer.Write([]byte("hi"))
+
+	if text := cellText(buffer, 0, 0); text != "h" {
+		t.Errorf("Expected cell 0,0 to contain 'h' but got %q", text)
+	}
+
+	if text := cellText(buffer, 0, 1); text != "i" {
+		t.Errorf("Expected cell 0,1 to contain 'i' but got %q", text)
+	}
+}
+
+func TestTerminalBufferCarriageReturnAndLineFeedMoveCursor(t *testing.T) {
+	buffer := newTestTerminalBuffer(5, 10)
+
+	buffer.Write([]byte("ab\r\ncd"))
+
+	if text := cellText(buffer, 1, 0); text != "c" {
+		t.Errorf("Expected cell 1,0 to contain 'c' but got %q", text)
+	}
+
+	if text := cellText(buffer, 1, 1); text != "d" {
+		t.Errorf("Expected cell 1,1 to contain 'd' but got %q", text)
+	}
+}
+
+func TestTerminalBufferCursorUpAtTopRowStaysPinnedToBoundary(t *testing.T) {
+	buffer := newTestTerminalBuffer(5, 10)
+
+	// CSI A (cursor up) with no preceding movement; the cursor is already
+	// at row 0, so this must not underflow and wrap around to the bottom
+	// of the buffer.
+	buffer.Write([]byte("\x1b[A"))
+
+	if buffer.cursorRow != 0 {
+		t.Errorf("Expected cursor row to stay pinned at 0 but got %v", buffer.cursorRow)
+	}
+}
+
+func TestTerminalBufferCursorBackAtLeftColumnStaysPinnedToBoundary(t *testing.T) {
+	buffer := newTestTerminalBuffer(5, 10)
+
+	// CSI D (cursor back) at column 0 must not underflow and wrap around
+	// to the last column of the buffer.
+	buffer.Write([]byte("\x1b[D"))
+
+	if buffer.cursorCol != 0 {
+		t.Errorf("Expected cursor column to stay pinned at 0 but got %v", buffer.cursorCol)
+	}
+}
+
+func TestTerminalBufferCursorPositionIsClampedToBufferBounds(t *testing.T) {
+	buffer := newTestTerminalBuffer(5, 10)
+
+	buffer.Write([]byte("\x1b[100;100H"))
+
+	if buffer.cursorRow != 4 {
+		t.Errorf("Expected cursor row to be clamped to 4 but got %v", buffer.cursorRow)
+	}
+
+	if buffer.cursorCol != 9 {
+		t.Errorf("Expected cursor column to be clamped to 9 but got %v", buffer.cursorCol)
+	}
+}
+
+func TestTerminalBufferSGRSetsForegroundColor(t *testing.T) {
+	buffer := newTestTerminalBuffer(5, 10)
+
+	buffer.Write([]byte("\x1b[31mx"))
+
+	cell := buffer.Lines()[0].cells[0]
+	if cell.style.fg == nil {
+		t.Fatal("Expected cell to have a foreground color set")
+	}
+
+	expected := terminalPalette16[1]
+	if *cell.style.fg != expected {
+		t.Errorf("Expected foreground color %v but got %v", expected, *cell.style.fg)
+	}
+}
+
+func TestTerminalBufferSGRResetClearsStyle(t *testing.T) {
+	buffer := newTestTerminalBuffer(5, 10)
+
+	buffer.Write([]byte("\x1b[31mx\x1b[0my"))
+
+	cell := buffer.Lines()[0].cells[1]
+	if cell.style.fg != nil {
+		t.Errorf("Expected SGR reset to clear the foreground color but got %v", *cell.style.fg)
+	}
+}
+
+func TestTerminalBufferInputForwardsToAttachedPty(t *testing.T) {
+	buffer := newTestTerminalBuffer(5, 10)
+
+	childPty, tty, err := pty.Open()
+	if err != nil {
+		t.Fatalf("Failed to open pty: %v", err)
+	}
+	defer childPty.Close()
+	defer tty.Close()
+
+	buffer.SetPty(childPty)
+
+	if _, err := buffer.Input([]byte("ls\n")); err != nil {
+		t.Fatalf("Unexpected error forwarding input to pty: %v", err)
+	}
+
+	read := make([]byte, 3)
+	if _, err := tty.Read(read); err != nil {
+		t.Fatalf("Unexpected error reading input back from tty: %v", err)
+	}
+
+	if string(read) != "ls\n" {
+		t.Errorf("Expected tty to receive %q but got %q", "ls\n", read)
+	}
+}
+
+func TestTerminalBufferInputWithoutPtyIsANoop(t *testing.T) {
+	buffer := newTestTerminalBuffer(5, 10)
+
+	if _, err := buffer.Input([]byte("ls\n")); err != nil {
+		t.Errorf("Expected forwarding input with no attached pty to be a no-op but got error: %v", err)
+	}
+}
+
+func TestTerminalBufferResizePropagatesToAttachedPty(t *testing.T) {
+	buffer := newTestTerminalBuffer(5, 10)
+
+	childPty, tty, err := pty.Open()
+	if err != nil {
+		t.Fatalf("Failed to open pty: %v", err)
+	}
+	defer childPty.Close()
+	defer tty.Close()
+
+	buffer.SetPty(childPty)
+	buffer.Resize(20, 80)
+
+	size, err := pty.GetsizeFull(childPty)
+	if err != nil {
+		t.Fatalf("Unexpected error reading pty size: %v", err)
+	}
+
+	if size.Rows != 20 || size.Cols != 80 {
+		t.Errorf("Expected pty to be resized to rows:20,cols:80 but got rows:%v,cols:%v", size.Rows, size.Cols)
+	}
+}
+
+func TestTerminalBufferUnknownEscapeSequenceIsDroppedWithoutDesyncing(t *testing.T) {
+	buffer := newTestTerminalBuffer(5, 10)
+
+	// \x1bZ is not a sequence grv recognises; it must be dropped without
+	// corrupting parsing of the text that follows it.
+	buffer.Write([]byte("\x1bZab"))
+
+	if text := cellText(buffer, 0, 0); text != "a" {
+		t.Errorf("Expected parser to resynchronise after an unknown escape sequence but got %q", text)
+	}
+}
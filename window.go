@@ -9,6 +9,7 @@ import (
 	"os"
 	"time"
 	"unicode"
+	"unicode/utf8"
 )
 
 const (
@@ -48,15 +49,54 @@ type LineBuilder struct {
 	config      Config
 }
 
+// Attr is a backend-neutral set of text attribute bits (bold, reverse,
+// ...), so that CellStyle does not tie every RenderBackend to goncurses'
+// gc.Char attribute constants.
+type Attr uint16
+
+// The text attributes a CellStyle can carry. Each RenderBackend is
+// responsible for mapping these onto whatever its underlying library uses.
+const (
+	AttrNone      Attr = 0
+	AttrBold      Attr = 1 << (iota - 1)
+	AttrDim
+	AttrReverse
+	AttrUnderline
+)
+
 type CellStyle struct {
 	componentId ThemeComponentId
-	attr        gc.Char
+	attr        Attr
 	acs_char    gc.Char
+	fg          *RGBColor
+	bg          *RGBColor
+}
+
+// equal compares two CellStyles by value, dereferencing fg/bg rather than
+// comparing their pointers, since callers generally build a fresh RGBColor
+// per render call and only ever compare the colors it points to.
+func (style CellStyle) equal(other CellStyle) bool {
+	return style.componentId == other.componentId &&
+		style.attr == other.attr &&
+		style.acs_char == other.acs_char &&
+		rgbColorEqual(style.fg, other.fg) &&
+		rgbColorEqual(style.bg, other.bg)
+}
+
+// rgbColorEqual compares two possibly-nil RGBColor pointers by value.
+func rgbColorEqual(a, b *RGBColor) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
 }
 
 type Cell struct {
-	codePoints bytes.Buffer
-	style      CellStyle
+	codePoints  bytes.Buffer
+	style       CellStyle
+	hitTag      HitTag
+	imagePlaced bool
 }
 
 type Cursor struct {
@@ -64,15 +104,27 @@ type Cursor struct {
 	col uint
 }
 
-type Window struct {
-	id       string
-	rows     uint
-	cols     uint
-	lines    []*Line
+// Region describes a rectangular area of a Window's cell grid, in
+// window-relative row/column coordinates.
+type Region struct {
 	startRow uint
 	startCol uint
-	config   Config
-	cursor   *Cursor
+	rows     uint
+	cols     uint
+}
+
+type Window struct {
+	id          string
+	rows        uint
+	cols        uint
+	lines       []*Line
+	prevLines   []*Line
+	invalidated []Region
+	startRow    uint
+	startCol    uint
+	config      Config
+	cursor      *Cursor
+	images      []ImagePlacement
 }
 
 func NewLine(cols uint) *Line {
@@ -101,6 +153,14 @@ func (lineBuilder *LineBuilder) Append(format string, args ...interface{}) *Line
 }
 
 func (lineBuilder *LineBuilder) AppendWithStyle(componentId ThemeComponentId, format string, args ...interface{}) *LineBuilder {
+	return lineBuilder.AppendWithStyleAndColor(componentId, nil, nil, format, args...)
+}
+
+// AppendWithStyleAndColor behaves like AppendWithStyle but additionally
+// allows a theme to override the foreground and/or background colour of the
+// appended text with explicit 24-bit RGB values, rather than being limited
+// to whatever colour the ncurses component id resolves to.
+func (lineBuilder *LineBuilder) AppendWithStyleAndColor(componentId ThemeComponentId, fg, bg *RGBColor, format string, args ...interface{}) *LineBuilder {
 	str := fmt.Sprintf(format, args...)
 	line := lineBuilder.line
 
@@ -113,10 +173,10 @@ func (lineBuilder *LineBuilder) AppendWithStyle(componentId ThemeComponentId, fo
 			}
 
 			if renderedCodePoint.width > 1 {
-				lineBuilder.setCellAndAdvanceIndex(renderedCodePoint.codePoint, renderedCodePoint.width, componentId)
+				lineBuilder.setCellAndAdvanceIndex(renderedCodePoint.codePoint, renderedCodePoint.width, componentId, fg, bg)
 				lineBuilder.Clear(renderedCodePoint.width - 1)
 			} else if renderedCodePoint.width > 0 {
-				lineBuilder.setCellAndAdvanceIndex(renderedCodePoint.codePoint, renderedCodePoint.width, componentId)
+				lineBuilder.setCellAndAdvanceIndex(renderedCodePoint.codePoint, renderedCodePoint.width, componentId, fg, bg)
 			} else {
 				lineBuilder.appendToPreviousCell(renderedCodePoint.codePoint)
 			}
@@ -126,16 +186,42 @@ func (lineBuilder *LineBuilder) AppendWithStyle(componentId ThemeComponentId, fo
 	return lineBuilder
 }
 
-func (lineBuilder *LineBuilder) setCellAndAdvanceIndex(codePoint rune, width uint, componentId ThemeComponentId) {
+// AppendWithStyleAndTag behaves like AppendWithStyle but additionally tags
+// every cell the appended text occupies with the given HitTag, so a click
+// landing on this text can later be resolved with Window.HitTest back to
+// whatever object (commit, ref, file path, ...) it represents.
+func (lineBuilder *LineBuilder) AppendWithStyleAndTag(componentId ThemeComponentId, tag HitTag, format string, args ...interface{}) *LineBuilder {
+	startIndex := lineBuilder.cellIndex
+	lineBuilder.AppendWithStyle(componentId, format, args...)
+	lineBuilder.tagCells(startIndex, lineBuilder.cellIndex, tag)
+
+	return lineBuilder
+}
+
+func (lineBuilder *LineBuilder) tagCells(fromIndex, toIndex uint, tag HitTag) {
+	line := lineBuilder.line
+
+	for i := fromIndex; i < toIndex && i < uint(len(line.cells)); i++ {
+		line.cells[i].hitTag = tag
+	}
+}
+
+func (lineBuilder *LineBuilder) setCellAndAdvanceIndex(codePoint rune, width uint, componentId ThemeComponentId, fg, bg *RGBColor) {
 	line := lineBuilder.line
 
 	if lineBuilder.cellIndex < uint(len(line.cells)) {
 		if lineBuilder.column >= lineBuilder.startColumn {
 			cell := line.cells[lineBuilder.cellIndex]
-			cell.codePoints.Reset()
-			cell.codePoints.WriteRune(codePoint)
-			cell.style.componentId = componentId
-			cell.style.acs_char = 0
+
+			if !cell.imagePlaced {
+				cell.codePoints.Reset()
+				cell.codePoints.WriteRune(codePoint)
+				cell.style.componentId = componentId
+				cell.style.acs_char = 0
+				cell.style.fg = fg
+				cell.style.bg = bg
+			}
+
 			lineBuilder.cellIndex++
 		}
 
@@ -186,6 +272,109 @@ func (win *Window) Resize(viewDimension ViewDimension) {
 	for i := uint(0); i < win.rows; i++ {
 		win.lines[i] = NewLine(win.cols)
 	}
+
+	// The previous frame no longer corresponds to this window's
+	// dimensions, so the next flush must repaint every cell.
+	win.prevLines = nil
+	win.invalidated = nil
+}
+
+// Invalidate marks a subregion of the window as dirty, so that it is
+// repainted on the next Flush even if the cells within it are unchanged
+// from the previous frame. This is for callers that know a region needs to
+// be redrawn for a reason Flush's own content comparison cannot see, e.g.
+// the underlying terminal itself having been corrupted by another program.
+func (win *Window) Invalidate(region Region) {
+	win.invalidated = append(win.invalidated, region)
+}
+
+func (region Region) contains(row, col uint) bool {
+	return row >= region.startRow && row < region.startRow+region.rows &&
+		col >= region.startCol && col < region.startCol+region.cols
+}
+
+// Flush diffs the window's current cell grid against what was drawn to the
+// backend on the previous call, and writes only the cells that changed (or
+// fall within a region explicitly passed to Invalidate). This replaces
+// clearing and repainting every cell on every frame, which dominates
+// terminal write volume when scrolling a large list.
+func (win *Window) Flush(backend RenderBackend) error {
+	if err := win.flushImages(backend); err != nil {
+		return err
+	}
+
+	for rowIndex, line := range win.lines {
+		var prevLine *Line
+		if win.prevLines != nil {
+			prevLine = win.prevLines[rowIndex]
+		}
+
+		for colIndex, cell := range line.cells {
+			if cell.imagePlaced {
+				continue
+			}
+
+			if !win.cellDirty(cell, prevLine, uint(rowIndex), uint(colIndex)) {
+				continue
+			}
+
+			codePoint := ' '
+			if cell.codePoints.Len() > 0 {
+				codePoint, _ = utf8.DecodeRune(cell.codePoints.Bytes())
+			}
+
+			if err := backend.SetCell(win.startRow+uint(rowIndex), win.startCol+uint(colIndex), codePoint, cell.style); err != nil {
+				return err
+			}
+		}
+	}
+
+	if win.cursor != nil {
+		if err := backend.SetCursor(win.startRow+win.cursor.row, win.startCol+win.cursor.col); err != nil {
+			return err
+		}
+	} else {
+		backend.HideCursor()
+	}
+
+	win.prevLines = cloneLines(win.lines)
+	win.invalidated = nil
+
+	return nil
+}
+
+func (win *Window) cellDirty(cell *Cell, prevLine *Line, rowIndex, colIndex uint) bool {
+	for _, region := range win.invalidated {
+		if region.contains(rowIndex, colIndex) {
+			return true
+		}
+	}
+
+	if prevLine == nil {
+		return true
+	}
+
+	prevCell := prevLine.cells[colIndex]
+
+	return !prevCell.style.equal(cell.style) || !bytes.Equal(prevCell.codePoints.Bytes(), cell.codePoints.Bytes())
+}
+
+func cloneLines(lines []*Line) []*Line {
+	cloned := make([]*Line, len(lines))
+
+	for i, line := range lines {
+		clonedLine := &Line{cells: make([]*Cell, len(line.cells))}
+
+		for j, cell := range line.cells {
+			clonedCell := &Cell{style: cell.style}
+			clonedCell.codePoints.Write(cell.codePoints.Bytes())
+			clonedLine.cells[j] = clonedCell
+		}
+
+		cloned[i] = clonedLine
+	}
+
+	return cloned
 }
 
 func (win *Window) SetPosition(startRow, startCol uint) {
@@ -233,12 +422,17 @@ func (win *Window) Clear() {
 			cell.codePoints.Reset()
 			cell.codePoints.WriteRune(' ')
 			cell.style.componentId = CMP_NONE
-			cell.style.attr = gc.A_NORMAL
+			cell.style.attr = AttrNone
 			cell.style.acs_char = 0
+			cell.style.fg = nil
+			cell.style.bg = nil
+			cell.hitTag = ""
+			cell.imagePlaced = false
 		}
 	}
 
 	win.cursor = nil
+	win.images = nil
 }
 
 func (win *Window) LineBuilder(rowIndex, startColumn uint) (*LineBuilder, error) {
@@ -269,10 +463,10 @@ func (win *Window) SetSelectedRow(rowIndex uint, active bool) error {
 		return fmt.Errorf("Invalid row index: %v >= %v rows", rowIndex, win.rows)
 	}
 
-	var attr gc.Char = gc.A_REVERSE
+	var attr Attr = AttrReverse
 
 	if !active {
-		attr |= gc.A_DIM
+		attr |= AttrDim
 	}
 
 	line := win.lines[rowIndex]
@@ -383,9 +577,19 @@ func (win *Window) DrawBorder() {
 }
 
 func (win *Window) ApplyStyle(themeComponentId ThemeComponentId) {
+	win.ApplyStyleWithColor(themeComponentId, nil, nil)
+}
+
+// ApplyStyleWithColor behaves like ApplyStyle but additionally sets an
+// explicit 24-bit RGB foreground and/or background colour on every cell in
+// the window, for themes that declare colours beyond the fixed ncurses
+// component id table.
+func (win *Window) ApplyStyleWithColor(themeComponentId ThemeComponentId, fg, bg *RGBColor) {
 	for _, line := range win.lines {
 		for _, cell := range line.cells {
 			cell.style.componentId = themeComponentId
+			cell.style.fg = fg
+			cell.style.bg = bg
 		}
 	}
 }
@@ -425,16 +629,21 @@ func DetermineRenderedCodePoint(codePoint rune, column uint, config Config) (ren
 	return
 }
 
+// acsToUnicodeBorder maps the ncurses ACS border characters grv uses onto
+// the equivalent Unicode box drawing runes, for backends (and debug dumps)
+// that have no notion of ACS characters.
+var acsToUnicodeBorder = map[gc.Char]rune{
+	gc.ACS_HLINE:    0x2500,
+	gc.ACS_VLINE:    0x2502,
+	gc.ACS_ULCORNER: 0x250C,
+	gc.ACS_URCORNER: 0x2510,
+	gc.ACS_LLCORNER: 0x2514,
+	gc.ACS_LRCORNER: 0x2518,
+}
+
 // For debugging
 func (win *Window) DumpContent() error {
-	borderMap := map[gc.Char]rune{
-		gc.ACS_HLINE:    0x2500,
-		gc.ACS_VLINE:    0x2502,
-		gc.ACS_ULCORNER: 0x250C,
-		gc.ACS_URCORNER: 0x2510,
-		gc.ACS_LLCORNER: 0x2514,
-		gc.ACS_LRCORNER: 0x2518,
-	}
+	borderMap := acsToUnicodeBorder
 	var buffer bytes.Buffer
 
 	buffer.WriteString(fmt.Sprintf("%v Dumping window %v\n", time.Now().Format("2006/01/02 15:04:05.000"), win.id))
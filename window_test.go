@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestCellDirtyTreatsEqualByValueColorsAsClean(t *testing.T) {
+	win := &Window{}
+
+	prevLine := &Line{cells: []*Cell{
+		{style: CellStyle{fg: &RGBColor{0x12, 0x34, 0x56}}},
+	}}
+
+	cell := &Cell{style: CellStyle{fg: &RGBColor{0x12, 0x34, 0x56}}}
+
+	if win.cellDirty(cell, prevLine, 0, 0) {
+		t.Errorf("Expected cell with an equal but distinct fg pointer to be reported clean")
+	}
+}
+
+func TestCellDirtyDetectsChangedColor(t *testing.T) {
+	win := &Window{}
+
+	prevLine := &Line{cells: []*Cell{
+		{style: CellStyle{fg: &RGBColor{0x12, 0x34, 0x56}}},
+	}}
+
+	cell := &Cell{style: CellStyle{fg: &RGBColor{0x65, 0x43, 0x21}}}
+
+	if !win.cellDirty(cell, prevLine, 0, 0) {
+		t.Errorf("Expected cell with a changed fg color to be reported dirty")
+	}
+}
+
+func TestCellDirtyDetectsNilVersusSetColor(t *testing.T) {
+	win := &Window{}
+
+	prevLine := &Line{cells: []*Cell{
+		{style: CellStyle{fg: nil}},
+	}}
+
+	cell := &Cell{style: CellStyle{fg: &RGBColor{0x12, 0x34, 0x56}}}
+
+	if !win.cellDirty(cell, prevLine, 0, 0) {
+		t.Errorf("Expected cell going from no fg color to a set fg color to be reported dirty")
+	}
+}
+
+func TestCellDirtyDetectsChangedCodePoints(t *testing.T) {
+	win := &Window{}
+
+	prevCell := &Cell{}
+	prevCell.codePoints.WriteRune('a')
+	prevLine := &Line{cells: []*Cell{prevCell}}
+
+	cell := &Cell{}
+	cell.codePoints.WriteRune('b')
+
+	if !win.cellDirty(cell, prevLine, 0, 0) {
+		t.Errorf("Expected cell with a changed code point to be reported dirty")
+	}
+}